@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the histogram bucket upper bounds, in seconds, used
+// for fetch_duration_seconds.
+var durationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Stats tracks live crawl progress so it can be served over the admin
+// listener. A crawl publishes to it as it goes; nil-receiver methods are
+// no-ops, so passing no Stats to Crawl/CrawlStream costs nothing. All
+// fields are guarded by mu and safe for concurrent use.
+type Stats struct {
+	mu sync.Mutex
+
+	startedAt    time.Time
+	fetchTotal   uint64
+	fetchErrors  uint64
+	nodesFetched uint64
+	secretsFound uint64
+	inFlight     int64
+	queueDepth   int
+
+	durCounts []uint64 // cumulative count per bucket in durationBuckets, plus one for +Inf
+	durSum    float64
+	durCount  uint64
+
+	tree map[string][]Secret
+}
+
+// NewStats returns a ready-to-use, empty Stats.
+func NewStats() *Stats {
+	return &Stats{
+		startedAt: time.Now(),
+		durCounts: make([]uint64, len(durationBuckets)+1),
+		tree:      map[string][]Secret{},
+	}
+}
+
+// beginFetch marks one more fetch as in flight.
+func (s *Stats) beginFetch() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.inFlight++
+	s.mu.Unlock()
+}
+
+// endFetch records the outcome of a fetch that beginFetch was called for.
+func (s *Stats) endFetch(dur time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight--
+	s.fetchTotal++
+	if err != nil {
+		s.fetchErrors++
+	}
+
+	secs := dur.Seconds()
+	s.durSum += secs
+	s.durCount++
+	for i, le := range durationBuckets {
+		if secs <= le {
+			s.durCounts[i]++
+		}
+	}
+	s.durCounts[len(durationBuckets)]++ // the +Inf bucket
+}
+
+// setQueueDepth records the number of jobs currently queued but not yet
+// picked up by a worker.
+func (s *Stats) setQueueDepth(n int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.queueDepth = n
+	s.mu.Unlock()
+}
+
+// recordNode appends a resolved node to the live tree snapshot and updates
+// the node/secret counters.
+func (s *Stats) recordNode(parentID string, secret Secret) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodesFetched++
+	if secret.Value != "" && secret.Value != "no" {
+		s.secretsFound++
+	}
+	s.tree[parentID] = append(s.tree[parentID], secret)
+}
+
+// StatsSnapshot is the JSON shape served at /status.
+type StatsSnapshot struct {
+	NodesFetched   uint64  `json:"nodes_fetched"`
+	FetchTotal     uint64  `json:"fetch_total"`
+	FetchErrors    uint64  `json:"fetch_errors"`
+	SecretsFound   uint64  `json:"secrets_found"`
+	InFlight       int64   `json:"in_flight"`
+	QueueDepth     int     `json:"queue_depth"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// Snapshot returns the current counters as a StatsSnapshot.
+func (s *Stats) Snapshot() StatsSnapshot {
+	if s == nil {
+		return StatsSnapshot{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return StatsSnapshot{
+		NodesFetched:   s.nodesFetched,
+		FetchTotal:     s.fetchTotal,
+		FetchErrors:    s.fetchErrors,
+		SecretsFound:   s.secretsFound,
+		InFlight:       s.inFlight,
+		QueueDepth:     s.queueDepth,
+		ElapsedSeconds: time.Since(s.startedAt).Seconds(),
+	}
+}
+
+// TreeSnapshot returns a deep copy of the tree as resolved so far.
+func (s *Stats) TreeSnapshot() map[string][]Secret {
+	if s == nil {
+		return map[string][]Secret{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string][]Secret, len(s.tree))
+	for id, children := range s.tree {
+		cp := make([]Secret, len(children))
+		copy(cp, children)
+		out[id] = cp
+	}
+	return out
+}
+
+// WriteMetrics writes the current counters to w in Prometheus text format.
+func (s *Stats) WriteMetrics(w io.Writer) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP fetch_total Total number of node fetch attempts.")
+	fmt.Fprintln(w, "# TYPE fetch_total counter")
+	fmt.Fprintf(w, "fetch_total %d\n", s.fetchTotal)
+
+	fmt.Fprintln(w, "# HELP fetch_errors_total Total number of node fetches that failed after retries.")
+	fmt.Fprintln(w, "# TYPE fetch_errors_total counter")
+	fmt.Fprintf(w, "fetch_errors_total %d\n", s.fetchErrors)
+
+	fmt.Fprintln(w, "# HELP inflight_requests Number of fetches currently in flight.")
+	fmt.Fprintln(w, "# TYPE inflight_requests gauge")
+	fmt.Fprintf(w, "inflight_requests %d\n", s.inFlight)
+
+	fmt.Fprintln(w, "# HELP fetch_duration_seconds Histogram of node fetch durations.")
+	fmt.Fprintln(w, "# TYPE fetch_duration_seconds histogram")
+	for i, le := range durationBuckets {
+		fmt.Fprintf(w, "fetch_duration_seconds_bucket{le=\"%g\"} %d\n", le, s.durCounts[i])
+	}
+	fmt.Fprintf(w, "fetch_duration_seconds_bucket{le=\"+Inf\"} %d\n", s.durCounts[len(durationBuckets)])
+	fmt.Fprintf(w, "fetch_duration_seconds_sum %g\n", s.durSum)
+	fmt.Fprintf(w, "fetch_duration_seconds_count %d\n", s.durCount)
+}
+
+// AdminServer exposes live crawl introspection over HTTP: JSON /status and
+// /tree, Prometheus-format /metrics, and the stdlib's /debug/pprof/
+// profiles.
+type AdminServer struct {
+	Addr  string
+	Stats *Stats
+}
+
+// NewAdminServer returns an AdminServer publishing stats at addr.
+func NewAdminServer(addr string, stats *Stats) *AdminServer {
+	return &AdminServer{Addr: addr, Stats: stats}
+}
+
+// Handler builds the admin mux. Exposed separately from ListenAndServe so
+// tests can exercise it with httptest.
+func (a *AdminServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", a.handleStatus)
+	mux.HandleFunc("/tree", a.handleTree)
+	mux.HandleFunc("/metrics", a.handleMetrics)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// ListenAndServe starts the admin listener. It blocks until the listener
+// fails, so callers typically run it in its own goroutine.
+func (a *AdminServer) ListenAndServe() error {
+	return http.ListenAndServe(a.Addr, a.Handler())
+}
+
+func (a *AdminServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.Stats.Snapshot())
+}
+
+func (a *AdminServer) handleTree(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.Stats.TreeSnapshot())
+}
+
+func (a *AdminServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	a.Stats.WriteMetrics(w)
+}
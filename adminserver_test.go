@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminServerStatusAndTree(t *testing.T) {
+	stats := NewStats()
+	stats.recordNode("ROOT", Secret{ID: "a", Value: "no"})
+	stats.recordNode("a", Secret{ID: "b", Value: "hunter2"})
+	stats.beginFetch()
+	stats.endFetch(10*time.Millisecond, nil)
+
+	srv := httptest.NewServer(NewAdminServer("", stats).Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/status")
+	if err != nil {
+		t.Fatalf("GET /status: %v", err)
+	}
+	defer resp.Body.Close()
+	var snap StatsSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+		t.Fatalf("decode /status: %v", err)
+	}
+	if snap.NodesFetched != 2 {
+		t.Fatalf("NodesFetched = %d, want 2", snap.NodesFetched)
+	}
+	if snap.SecretsFound != 1 {
+		t.Fatalf("SecretsFound = %d, want 1", snap.SecretsFound)
+	}
+	if snap.FetchTotal != 1 {
+		t.Fatalf("FetchTotal = %d, want 1", snap.FetchTotal)
+	}
+
+	treeResp, err := http.Get(srv.URL + "/tree")
+	if err != nil {
+		t.Fatalf("GET /tree: %v", err)
+	}
+	defer treeResp.Body.Close()
+	var tree map[string][]Secret
+	if err := json.NewDecoder(treeResp.Body).Decode(&tree); err != nil {
+		t.Fatalf("decode /tree: %v", err)
+	}
+	if len(tree["ROOT"]) != 1 || len(tree["a"]) != 1 {
+		t.Fatalf("tree = %v, want one child each under ROOT and a", tree)
+	}
+}
+
+func TestAdminServerMetricsBucketing(t *testing.T) {
+	stats := NewStats()
+	stats.beginFetch()
+	stats.endFetch(5*time.Millisecond, nil) // falls in the 0.01s bucket
+	stats.beginFetch()
+	stats.endFetch(time.Second, errors.New("fetch failed")) // falls in the 1s bucket (le is inclusive), and counts as an error
+
+	srv := httptest.NewServer(NewAdminServer("", stats).Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		t.Fatalf("read /metrics: %v", err)
+	}
+	body := buf.String()
+
+	if !strings.Contains(body, "fetch_total 2\n") {
+		t.Fatalf("/metrics missing fetch_total 2:\n%s", body)
+	}
+	if !strings.Contains(body, "fetch_errors_total 1\n") {
+		t.Fatalf("/metrics missing fetch_errors_total 1:\n%s", body)
+	}
+	// the 5ms fetch lands at-or-under every bucket from 0.01s up, so the
+	// 0.01s bucket should already show a cumulative count of 1.
+	if !strings.Contains(body, `fetch_duration_seconds_bucket{le="0.01"} 1`) {
+		t.Fatalf("/metrics 0.01s bucket not cumulatively 1:\n%s", body)
+	}
+	// the 1s fetch pushes the cumulative count to 2 starting at the 1s
+	// bucket, so the 2.5s bucket above it is cumulatively 2 as well.
+	if !strings.Contains(body, `fetch_duration_seconds_bucket{le="2.5"} 2`) {
+		t.Fatalf("/metrics 2.5s bucket not cumulatively 2:\n%s", body)
+	}
+}
+
+func TestStatsNilReceiverIsNoop(t *testing.T) {
+	var stats *Stats
+	stats.beginFetch()
+	stats.endFetch(time.Second, nil)
+	stats.setQueueDepth(5)
+	stats.recordNode("p", Secret{})
+
+	if snap := stats.Snapshot(); snap != (StatsSnapshot{}) {
+		t.Fatalf("Snapshot() on nil Stats = %+v, want zero value", snap)
+	}
+	if tree := stats.TreeSnapshot(); len(tree) != 0 {
+		t.Fatalf("TreeSnapshot() on nil Stats = %v, want empty", tree)
+	}
+}
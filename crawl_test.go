@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockFetcher serves fixed responses from a tree of mockNodes, honoring ctx
+// cancellation the same way HTTPFetcher is required to.
+type mockFetcher struct {
+	tree map[string]mockNode
+}
+
+type mockNode struct {
+	secret   string
+	next     []string
+	blockFor time.Duration // simulates a slow in-flight request
+}
+
+func (f *mockFetcher) Fetch(ctx context.Context, id string, session string) ([]byte, error) {
+	n, ok := f.tree[id]
+	if !ok {
+		return nil, fmt.Errorf("mockFetcher: no node for id %q", id)
+	}
+	if n.blockFor > 0 && !sleepCtx(ctx, n.blockFor) {
+		return nil, ctx.Err()
+	}
+	next := ""
+	if len(n.next) == 1 {
+		next = fmt.Sprintf("%q", n.next[0])
+	} else if len(n.next) > 1 {
+		quoted := make([]byte, 0)
+		quoted = append(quoted, '[')
+		for i, id := range n.next {
+			if i > 0 {
+				quoted = append(quoted, ',')
+			}
+			quoted = append(quoted, []byte(fmt.Sprintf("%q", id))...)
+		}
+		quoted = append(quoted, ']')
+		next = string(quoted)
+	} else {
+		next = `""`
+	}
+	return []byte(fmt.Sprintf(`{"id":%q,"secret":%q,"next":%s}`, id, n.secret, next)), nil
+}
+
+func TestCrawlBuildsTree(t *testing.T) {
+	f := &mockFetcher{tree: map[string]mockNode{
+		"a": {secret: "no", next: []string{"b", "c"}},
+		"b": {secret: "no", next: []string{"d"}},
+		"c": {secret: "hunter2"},
+		"d": {secret: "swordfish"},
+	}}
+
+	tree, err := Crawl(context.Background(), "a", CrawlOptions{Fetcher: f, Workers: 4})
+	if err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+
+	var secrets []string
+	var walk func(id string)
+	walk = func(id string) {
+		for _, s := range tree.Nodes[id] {
+			if s.Value != "" && s.Value != "no" {
+				secrets = append(secrets, s.Value)
+			}
+			walk(s.ID)
+		}
+	}
+	walk(tree.RootID)
+
+	if len(secrets) != 2 {
+		t.Fatalf("secrets = %v, want 2 entries", secrets)
+	}
+}
+
+func TestCrawlCancelsOnFetchError(t *testing.T) {
+	f := &mockFetcher{tree: map[string]mockNode{
+		"a":    {secret: "no", next: []string{"bad", "slow"}},
+		"slow": {secret: "no", blockFor: time.Second},
+	}}
+
+	start := time.Now()
+	_, err := Crawl(context.Background(), "a", CrawlOptions{Fetcher: f, Workers: 4})
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("Crawl: want error for missing node \"bad\", got nil")
+	}
+	// "slow" blocks for 1s unless ctx cancellation (triggered by "bad"'s
+	// fetch error) actually interrupts its in-flight fetch.
+	if elapsed > 500*time.Millisecond {
+		t.Fatalf("Crawl took %v, want ctx cancellation to abort the in-flight fetch promptly", elapsed)
+	}
+}
+
+func TestSessionManagerRenewOnAuthError(t *testing.T) {
+	var mu sync.Mutex
+	renewed := false
+	sm, err := NewSessionManager(func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if renewed {
+			return "fresh-session", nil
+		}
+		renewed = true
+		return "stale-session", nil
+	}, 1)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+
+	attempt := 0
+	f := &authOnceFetcher{ptr: &attempt}
+
+	_, err = Crawl(context.Background(), "a", CrawlOptions{
+		Fetcher:  f,
+		Sessions: sm,
+		Workers:  1,
+	})
+	if err != nil {
+		t.Fatalf("Crawl: %v", err)
+	}
+	if attempt < 2 {
+		t.Fatalf("attempt = %d, want at least 2 (initial + retry after renew)", attempt)
+	}
+}
+
+// authOnceFetcher fails every fetch with an AuthError until it's been called
+// at least twice, used to exercise SessionManager's renew-and-retry path.
+type authOnceFetcher struct {
+	mu  sync.Mutex
+	ptr *int
+}
+
+func (f *authOnceFetcher) Fetch(ctx context.Context, id string, session string) ([]byte, error) {
+	f.mu.Lock()
+	*f.ptr++
+	n := *f.ptr
+	f.mu.Unlock()
+	if n == 1 {
+		return nil, &AuthError{StatusCode: 401}
+	}
+	return []byte(fmt.Sprintf(`{"id":%q,"secret":"ok","next":""}`, id)), nil
+}
@@ -2,12 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
 	"sort"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -23,6 +28,14 @@ type CurbIDResponse struct {
 	Next       NextWrapper `json:"next"`
 	ParentID   string
 	OrderIndex int
+	// JobID is the node ID that was actually requested, independent of what
+	// the response body itself reports as "id". It's used to reconcile the
+	// outstanding frontier when checkpointing to a StateStore.
+	JobID string `json:"-"`
+	// Err holds a fetch failure that survived all retries. It is carried on
+	// the response (instead of panicking) so the crawl loop can decide how
+	// to recover.
+	Err error `json:"-"`
 }
 
 type NextWrapper struct {
@@ -56,27 +69,24 @@ type Secret struct {
 const SESSION_URL = "http://challenge.curbside.com/get-session"
 const ID_URL = "http://challenge.curbside.com/"
 
-// allow only 16 simultaneous requests
-var requestsChan = make(chan bool, 16)
-
-// create a buffered channel with buffer size of 8000. this channel is used as a requests limiter.
-// if create unbuffered channel then sender will block because on request may provide multiple results
-var resultsChan = make(chan CurbIDResponse, 8000)
-
-// setting up shared HTTP transport and client
-var netTransport = &http.Transport{
-	Dial: (&net.Dialer{
-		Timeout: 10 * time.Second,
-	}).Dial,
-	TLSHandshakeTimeout: 10 * time.Second,
-	MaxIdleConns:        1,
-	MaxIdleConnsPerHost: 1,
+// newHTTPClient returns the shared HTTP transport/client configuration used
+// both for fetching the session and for fetching tree nodes.
+func newHTTPClient() *http.Client {
+	netTransport := &http.Transport{
+		Dial: (&net.Dialer{
+			Timeout: 10 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        1,
+		MaxIdleConnsPerHost: 1,
+	}
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: netTransport,
+	}
 }
 
-var client = &http.Client{
-	Timeout:   10 * time.Second,
-	Transport: netTransport,
-}
+var client = newHTTPClient()
 
 // getSession returns a new sessionID used in further processing as a HTTP request header
 func getSession() (string, error) {
@@ -104,43 +114,279 @@ func getSession() (string, error) {
 	return s.SessionID, nil
 }
 
-// fetchID requests a data from single URL ID, and sends result to the results channel (defined as global)
-func fetchID(id string, session string, parentID string, orderIndex int) {
-	url := ID_URL + id
+// Fetcher abstracts the transport used to retrieve a single node's raw body,
+// so the crawl logic can be tested against a mock instead of the real
+// challenge server and so alternative transports can be swapped in.
+// Implementations must respect ctx cancellation so a cancelled crawl
+// doesn't leave fetches blocked in flight.
+type Fetcher interface {
+	Fetch(ctx context.Context, id string, session string) ([]byte, error)
+}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		panic(err)
+// RetryConfig controls the retry/backoff behavior of an HTTPFetcher.
+type RetryConfig struct {
+	// MaxRetries is the number of additional attempts after the first one.
+	MaxRetries int
+	// BaseDelay is the starting backoff delay, doubled on every retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay before jitter is applied.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryConfig is used by NewHTTPFetcher unless the caller overrides it.
+var DefaultRetryConfig = RetryConfig{
+	MaxRetries: 5,
+	BaseDelay:  200 * time.Millisecond,
+	MaxDelay:   5 * time.Second,
+}
+
+// RateLimiter is a simple token-bucket limiter shared across workers so the
+// crawl can enforce a requests/sec budget on top of the worker pool's own
+// concurrency cap.
+type RateLimiter struct {
+	mu         sync.Mutex
+	tokens     float64
+	burst      float64
+	perSecond  float64
+	lastRefill time.Time
+}
+
+// NewRateLimiter returns a limiter allowing perSecond requests/sec on
+// average, with room for a burst of up to burst requests. A perSecond of 0
+// disables rate limiting.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
 	}
+	return &RateLimiter{
+		tokens:     float64(burst),
+		burst:      float64(burst),
+		perSecond:  perSecond,
+		lastRefill: time.Now(),
+	}
+}
 
-	req.Header.Add("session", session)
+// Wait blocks until a token is available or ctx is done, then consumes a
+// token in the former case.
+func (r *RateLimiter) Wait(ctx context.Context) {
+	if r == nil || r.perSecond <= 0 {
+		return
+	}
+	for {
+		r.mu.Lock()
+		now := time.Now()
+		elapsed := now.Sub(r.lastRefill).Seconds()
+		r.tokens += elapsed * r.perSecond
+		if r.tokens > r.burst {
+			r.tokens = r.burst
+		}
+		r.lastRefill = now
+		if r.tokens >= 1 {
+			r.tokens--
+			r.mu.Unlock()
+			return
+		}
+		wait := time.Duration((1 - r.tokens) / r.perSecond * float64(time.Second))
+		r.mu.Unlock()
+		if !sleepCtx(ctx, wait) {
+			return
+		}
+	}
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		panic(err)
+// sleepCtx sleeps for d, returning false early if ctx is done first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		select {
+		case <-ctx.Done():
+			return false
+		default:
+			return true
+		}
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
 	}
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		panic(err)
+// HTTPFetcher is the default Fetcher implementation. It retries 5xx
+// responses and timeouts with exponential backoff and jitter, honors a
+// server-provided Retry-After header, and enforces a token-bucket rate
+// limit in addition to whatever concurrency cap the caller applies.
+type HTTPFetcher struct {
+	client  *http.Client
+	baseURL string
+	limiter *RateLimiter
+	retry   RetryConfig
+	// AuthStatusCodes are the response codes treated as an expired/rejected
+	// session (returned as *AuthError) rather than a generic fetch failure.
+	// Defaults to defaultAuthStatusCodes.
+	AuthStatusCodes []int
+	// AuthBodyMatch, if set, is consulted in addition to AuthStatusCodes:
+	// a response whose body it matches is also treated as an expired/
+	// rejected session, even on a 200. Some servers signal session expiry
+	// with a 200 and an error body rather than a 401/403. See
+	// AuthBodyContains for a ready-made matcher.
+	AuthBodyMatch func(body []byte) bool
+}
+
+// NewHTTPFetcher builds an HTTPFetcher against baseURL. A nil limiter means
+// no rate limiting beyond the caller's own concurrency cap.
+func NewHTTPFetcher(baseURL string, limiter *RateLimiter, retry RetryConfig) *HTTPFetcher {
+	return &HTTPFetcher{
+		client:  newHTTPClient(),
+		baseURL: baseURL,
+		limiter: limiter,
+		retry:   retry,
 	}
+}
 
-	if resp.StatusCode != 200 {
-		panic(fmt.Sprintf("bad response status code %v", resp.StatusCode))
+// isAuthFailure reports whether the response indicates the session used for
+// the request has expired or was rejected, via either a matching status
+// code or, if AuthBodyMatch is set, a matching body.
+func (f *HTTPFetcher) isAuthFailure(code int, body []byte) bool {
+	codes := f.AuthStatusCodes
+	if codes == nil {
+		codes = defaultAuthStatusCodes
 	}
-	// Preventing mixed case field names ("next", "NeXT", etc.)
-	body = bytes.ToLower(body)
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return f.AuthBodyMatch != nil && f.AuthBodyMatch(body)
+}
 
-	var idResponse = new(CurbIDResponse)
-	idResponse.Secret = "no"
-	idResponse.ParentID = parentID
-	idResponse.OrderIndex = orderIndex
+// AuthBodyContains returns an HTTPFetcher.AuthBodyMatch that flags a
+// response body containing substr as an expired/rejected session, for
+// servers that signal session expiry with a 200 and an error body instead
+// of a 401/403.
+func AuthBodyContains(substr string) func([]byte) bool {
+	return func(body []byte) bool {
+		return bytes.Contains(body, []byte(substr))
+	}
+}
 
-	err = json.Unmarshal(body, &idResponse)
-	if err != nil {
-		panic(err)
+// Fetch implements Fetcher.
+func (f *HTTPFetcher) Fetch(ctx context.Context, id string, session string) ([]byte, error) {
+	url := f.baseURL + id
+
+	var lastErr error
+	// skipBackoff is set when the previous attempt already waited out a
+	// server-provided Retry-After, so the next attempt doesn't also pay the
+	// independently-computed exponential backoff on top of it.
+	skipBackoff := false
+	for attempt := 0; attempt <= f.retry.MaxRetries; attempt++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if attempt > 0 && !skipBackoff {
+			if !sleepCtx(ctx, f.backoff(attempt, 0)) {
+				return nil, ctx.Err()
+			}
+		}
+		skipBackoff = false
+		f.limiter.Wait(ctx)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("session", session)
+
+		resp, err := f.client.Do(req)
+		if err != nil {
+			lastErr = err
+			if isTimeoutErr(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		body, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			lastErr = readErr
+			continue
+		}
+
+		if resp.StatusCode >= 500 {
+			lastErr = fmt.Errorf("bad response status code %v", resp.StatusCode)
+			if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				if !sleepCtx(ctx, wait) {
+					return nil, ctx.Err()
+				}
+				skipBackoff = true
+			}
+			continue
+		}
+		if f.isAuthFailure(resp.StatusCode, body) {
+			return nil, &AuthError{StatusCode: resp.StatusCode, Body: body}
+		}
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("bad response status code %v", resp.StatusCode)
+		}
+		return body, nil
+	}
+	return nil, fmt.Errorf("fetch %s: exceeded %d retries: %w", id, f.retry.MaxRetries, lastErr)
+}
+
+// backoff returns the exponential delay for the given attempt (1-indexed),
+// capped at MaxDelay and jittered by up to +/-50%.
+func (f *HTTPFetcher) backoff(attempt int, _ int) time.Duration {
+	base := f.retry.BaseDelay
+	if base <= 0 {
+		base = DefaultRetryConfig.BaseDelay
+	}
+	max := f.retry.MaxDelay
+	if max <= 0 {
+		max = DefaultRetryConfig.MaxDelay
+	}
+	delay := base << uint(attempt-1)
+	if delay > max || delay <= 0 {
+		delay = max
 	}
-	resultsChan <- *idResponse
+	jitter := time.Duration(rand.Int63n(int64(delay)+1)) - delay/2
+	delay += jitter
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+// isTimeoutErr reports whether err looks like a transient network timeout
+// worth retrying.
+func isTimeoutErr(err error) bool {
+	type timeout interface {
+		Timeout() bool
+	}
+	if t, ok := err.(timeout); ok {
+		return t.Timeout()
+	}
+	if netErr, ok := err.(net.Error); ok {
+		return netErr.Timeout()
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header value, which may be given in
+// seconds, into a wait duration.
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	return 0, false
 }
 
 // readSecretsMap reads the resulting hashmap and prints secrets in the right order
@@ -157,55 +403,317 @@ func readSecretsMap(secretsMap map[string][]Secret, id string) {
 	}
 }
 
-// crawl traverses the full tree of URLs and prints the results (secrets) at the end
-func crawl(id string, session string) {
-	rootID := "ROOT"
-	secretsMap := map[string][]Secret{}
-	go fetchID(id, session, rootID, 0)
-	// 1 url is currently being fetched in background, loop while fetching
-	for fetching := 1; fetching > 0; fetching-- {
-		idResponse := <-resultsChan
+// job describes a single node queued for fetching.
+type job struct {
+	id         string
+	parentID   string
+	orderIndex int
+}
+
+// CrawlOptions configures a Crawl invocation. Any zero-valued field falls
+// back to a sane default, so a caller can pass an empty CrawlOptions.
+type CrawlOptions struct {
+	// Fetcher is the transport used to retrieve each node. Defaults to an
+	// HTTPFetcher against ID_URL.
+	Fetcher Fetcher
+	// Session is the auth token attached to every fetch. Ignored if Sessions
+	// is set.
+	Session string
+	// Sessions, if set, supplies a session per fetch from a pool, renewing
+	// whichever one the server reports as expired instead of panicking.
+	// Takes precedence over Session.
+	Sessions *SessionManager
+	// Workers bounds how many fetches run concurrently. Defaults to 16.
+	Workers int
+	// Store, if set, checkpoints each visited node and the outstanding
+	// frontier as the crawl progresses. If it already holds a frontier when
+	// Crawl starts, the crawl resumes from it instead of startID.
+	Store StateStore
+	// Stats, if set, is published to as the crawl progresses, so it can be
+	// served live over an AdminServer.
+	Stats *Stats
+}
+
+// Tree is the result of a completed crawl: the visited nodes keyed by their
+// parent ID, in the shape readSecretsMap walks.
+type Tree struct {
+	RootID string
+	Nodes  map[string][]Secret
+}
+
+// rootID is the synthetic parent ID of the crawl's starting node.
+const rootID = "ROOT"
 
-		if idResponse.Message != "" && idResponse.Depth != 0 {
-			panic(fmt.Sprintf("got unexpected message: %v\n", idResponse.Message))
+// Crawl traverses the tree of URL IDs rooted at startID using a fixed pool
+// of opts.Workers workers pulling jobs from a shared queue, and returns the
+// assembled Tree. A fetch failure or an unexpected protocol message cancels
+// ctx, which every worker's in-flight Fetch call observes directly (via
+// http.NewRequestWithContext, an interruptible retry backoff, and an
+// interruptible rate-limiter wait), so requests abort immediately instead of
+// running their retry loop to completion in the background.
+func Crawl(ctx context.Context, startID string, opts CrawlOptions) (*Tree, error) {
+	tree := &Tree{RootID: rootID, Nodes: map[string][]Secret{}}
+	if opts.Store != nil {
+		if err := opts.Store.IterateVisited(func(id string, rec VisitedRecord) error {
+			tree.Nodes[rec.ParentID] = append(tree.Nodes[rec.ParentID], rec.Secret)
+			return nil
+		}); err != nil {
+			return nil, err
 		}
-		// filling a hashmap that represent the tree of visited nodes for further reading at the end
-		// a key in the map is a tree nodeID, values are node children
-		value := secretsMap[idResponse.ParentID]
-		secretsMap[idResponse.ParentID] = append(value, Secret{
-			ID:         idResponse.ID,
-			Value:      idResponse.Secret,
-			OrderIndex: idResponse.OrderIndex,
-		})
-		// if secret is found then we're at the bottom of the URLs tree,
-		// and there will be no "next" URLs to hop, so we just continue our loop
-		if idResponse.Secret != "no" {
-			continue
+	}
+
+	err := crawlLoop(ctx, startID, opts, func(idResponse CurbIDResponse, secret Secret) {
+		tree.Nodes[idResponse.ParentID] = append(tree.Nodes[idResponse.ParentID], secret)
+	})
+	return tree, err
+}
+
+// crawlLoop runs the worker pool and job dispatch shared by Crawl and
+// CrawlStream: it fetches nodes through opts.Workers workers, checkpoints
+// progress to opts.Store when set, and calls record for every node whose
+// secret/next-hop response was successfully resolved. A fetch failure or an
+// unexpected protocol message cancels ctx so every worker aborts cleanly,
+// instead of leaking goroutines or deadlocking on a full results buffer.
+func crawlLoop(ctx context.Context, startID string, opts CrawlOptions, record func(idResponse CurbIDResponse, secret Secret)) error {
+	fetcher := opts.Fetcher
+	if fetcher == nil {
+		fetcher = NewHTTPFetcher(ID_URL, NewRateLimiter(0, 16), DefaultRetryConfig)
+	}
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 16
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan job, workers*4)
+	results := make(chan CurbIDResponse, workers*4)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				session, slot := opts.Session, -1
+				if opts.Sessions != nil {
+					session, slot = opts.Sessions.Acquire()
+				}
+
+				opts.Stats.beginFetch()
+				start := time.Now()
+				idResponse := fetchNode(ctx, fetcher, j, session)
+				if authErr, ok := idResponse.Err.(*AuthError); ok && opts.Sessions != nil {
+					// the session expired mid-crawl; renew it and retry once
+					// instead of letting every subsequent fetch fail too.
+					if renewed, renewErr := opts.Sessions.Renew(slot); renewErr == nil {
+						idResponse = fetchNode(ctx, fetcher, j, renewed)
+					} else {
+						idResponse.Err = fmt.Errorf("renew session after %v: %w", authErr, renewErr)
+					}
+				}
+				opts.Stats.endFetch(time.Since(start), idResponse.Err)
+				select {
+				case results <- idResponse:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	frontier := map[string]FrontierJob{}
+
+	pending := 0
+	savedFrontier, err := storeFrontier(opts.Store)
+	if err != nil {
+		close(jobs)
+		return err
+	}
+	if len(savedFrontier) > 0 {
+		// resume from the saved frontier rather than starting over from startID
+		for _, fj := range savedFrontier {
+			frontier[fj.ID] = fj
+			pending++
+			jobs <- job{id: fj.ID, parentID: fj.ParentID, orderIndex: fj.OrderIndex}
+		}
+	} else {
+		fj := FrontierJob{ID: startID, ParentID: rootID, OrderIndex: 0}
+		frontier[fj.ID] = fj
+		pending++
+		jobs <- job{id: fj.ID, parentID: fj.ParentID, orderIndex: fj.OrderIndex}
+	}
+
+	var firstErr error
+
+loop:
+	for pending > 0 {
+		select {
+		case <-ctx.Done():
+			if firstErr == nil {
+				firstErr = ctx.Err()
+			}
+			break loop
+		case idResponse, ok := <-results:
+			if !ok {
+				break loop
+			}
+			pending--
+			delete(frontier, idResponse.JobID)
+
+			if idResponse.Err != nil {
+				if firstErr == nil {
+					firstErr = idResponse.Err
+				}
+				cancel()
+				continue
+			}
+			if idResponse.Message != "" && idResponse.Depth != 0 {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("got unexpected message: %v", idResponse.Message)
+				}
+				cancel()
+				continue
+			}
+
+			secret := Secret{
+				ID:         idResponse.ID,
+				Value:      idResponse.Secret,
+				OrderIndex: idResponse.OrderIndex,
+			}
+			record(idResponse, secret)
+			opts.Stats.recordNode(idResponse.ParentID, secret)
+			opts.Stats.setQueueDepth(len(jobs))
+
+			// if secret is found then we're at the bottom of the URLs tree,
+			// and there will be no "next" URLs to hop, so nothing to enqueue
+			if idResponse.Secret == "no" {
+				for index, nextID := range idResponse.Next.IDs {
+					fj := FrontierJob{ID: nextID, ParentID: idResponse.ID, OrderIndex: index}
+					pending++
+					select {
+					case jobs <- job{id: fj.ID, parentID: fj.ParentID, orderIndex: fj.OrderIndex}:
+						frontier[fj.ID] = fj
+					case <-ctx.Done():
+						pending--
+					}
+				}
+			}
+
+			if opts.Store != nil {
+				rec := VisitedRecord{ParentID: idResponse.ParentID, Secret: secret}
+				if err := opts.Store.Checkpoint(idResponse.JobID, rec, frontierList(frontier)); err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+					cancel()
+				}
+			}
 		}
+	}
+
+	close(jobs)
+	for range results {
+		// drain so workers blocked on a results send can observe ctx.Done and exit
+	}
 
-		// if there is no secret fetched then we should have next URL IDs to hop
-		for index, id := range idResponse.Next.IDs {
-			// make sure that we don't send more requests than requestsChan buffer size
-			requestsChan <- true
-			// increasing number of fetching URLs for keeping our for... loop
-			fetching++
-			// "index" value will keep the order of URL visits,
-			// which will help us to read the resulting data in a right order
-			go func(id string, index int) {
-				fetchID(id, session, idResponse.ID, index)
-				<-requestsChan
-			}(id, index)
+	if opts.Store != nil {
+		// Checkpoint may have batched this crawl's final writes; flush so
+		// they're durable before we report success or failure.
+		if err := opts.Store.Flush(); err != nil && firstErr == nil {
+			firstErr = err
 		}
 	}
-	close(resultsChan)
-	readSecretsMap(secretsMap, rootID)
+
+	return firstErr
 }
 
+// storeFrontier returns store's saved frontier, or nil if store is nil.
+func storeFrontier(store StateStore) ([]FrontierJob, error) {
+	if store == nil {
+		return nil, nil
+	}
+	return store.Frontier()
+}
+
+// frontierList flattens a frontier set into a slice suitable for
+// checkpointing.
+func frontierList(frontier map[string]FrontierJob) []FrontierJob {
+	list := make([]FrontierJob, 0, len(frontier))
+	for _, fj := range frontier {
+		list = append(list, fj)
+	}
+	return list
+}
+
+// fetchNode fetches a single job through fetcher and returns the resulting
+// CurbIDResponse, with Err set if the fetch or decode failed.
+func fetchNode(ctx context.Context, fetcher Fetcher, j job, session string) CurbIDResponse {
+	idResponse := CurbIDResponse{Secret: "no", ParentID: j.parentID, OrderIndex: j.orderIndex, JobID: j.id}
+
+	body, err := fetcher.Fetch(ctx, j.id, session)
+	if err != nil {
+		idResponse.Err = err
+		return idResponse
+	}
+	// Preventing mixed case field names ("next", "NeXT", etc.)
+	body = bytes.ToLower(body)
+
+	if err := json.Unmarshal(body, &idResponse); err != nil {
+		idResponse.Err = err
+	}
+	return idResponse
+}
+
+// stateFile is where the crawl checkpoints its progress, so a crashed or
+// interrupted run can resume instead of restarting from "start".
+const stateFile = "curbside-state.json"
+
+// adminAddr, if non-empty, is the address the admin/metrics HTTP listener
+// binds to (e.g. ":6060"). It's off by default.
+var adminAddr = flag.String("admin", "", "address for the admin/metrics HTTP listener, e.g. :6060 (empty disables it)")
+
+// sessionPoolSize is how many concurrent sessions to load-balance fetches
+// across, so a single session's server-side rate limit doesn't bottleneck
+// the crawl.
+var sessionPoolSize = flag.Int("sessions", 1, "number of concurrent sessions to load-balance fetches across")
+
 func main() {
-	session, err := getSession()
+	flag.Parse()
+
+	// sessions are fetched fresh on every run, even when resuming a crawl
+	// from a saved frontier, since the previous ones may have expired.
+	sessions, err := NewSessionManager(getSession, *sessionPoolSize)
+	if err != nil {
+		fmt.Printf("Error: %v", err.Error())
+		return
+	}
+	store, err := OpenFileStateStore(stateFile)
+	if err != nil {
+		fmt.Printf("Error: %v", err.Error())
+		return
+	}
+
+	var stats *Stats
+	if *adminAddr != "" {
+		stats = NewStats()
+		admin := NewAdminServer(*adminAddr, stats)
+		go func() {
+			if err := admin.ListenAndServe(); err != nil {
+				fmt.Printf("admin listener stopped: %v\n", err)
+			}
+		}()
+	}
+
+	tree, err := Crawl(context.Background(), "start", CrawlOptions{Sessions: sessions, Store: store, Stats: stats})
 	if err != nil {
 		fmt.Printf("Error: %v", err.Error())
 		return
 	}
-	crawl("start", session)
+	readSecretsMap(tree.Nodes, tree.RootID)
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPFetcherRetries5xxThenSucceeds(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"secret":"no"}`))
+	}))
+	defer srv.Close()
+
+	f := NewHTTPFetcher(srv.URL+"/", nil, RetryConfig{MaxRetries: 5, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+	body, err := f.Fetch(context.Background(), "abc", "sess")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if !strings.Contains(string(body), "secret") {
+		t.Fatalf("unexpected body: %s", body)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Fatalf("attempts = %d, want 3", got)
+	}
+}
+
+func TestHTTPFetcherAuthStatusCode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("session expired"))
+	}))
+	defer srv.Close()
+
+	f := NewHTTPFetcher(srv.URL+"/", nil, RetryConfig{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	_, err := f.Fetch(context.Background(), "abc", "sess")
+	authErr, ok := err.(*AuthError)
+	if !ok {
+		t.Fatalf("err = %v, want *AuthError", err)
+	}
+	if authErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("StatusCode = %d, want 401", authErr.StatusCode)
+	}
+}
+
+func TestHTTPFetcherAuthBodyMatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a server that signals expiry with 200 + an error body instead of
+		// a 401/403
+		w.Write([]byte(`{"error":"session_expired"}`))
+	}))
+	defer srv.Close()
+
+	f := NewHTTPFetcher(srv.URL+"/", nil, RetryConfig{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	f.AuthBodyMatch = AuthBodyContains("session_expired")
+	_, err := f.Fetch(context.Background(), "abc", "sess")
+	if _, ok := err.(*AuthError); !ok {
+		t.Fatalf("err = %v, want *AuthError", err)
+	}
+}
+
+func TestHTTPFetcherRetryAfterDoesNotStackWithBackoff(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"secret":"no"}`))
+	}))
+	defer srv.Close()
+
+	// BaseDelay is deliberately large: if the computed backoff ever stacks
+	// on top of the Retry-After wait, the observed delay blows well past
+	// the ~1s Retry-After told the client to wait.
+	f := NewHTTPFetcher(srv.URL+"/", nil, RetryConfig{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: 2 * time.Second})
+	start := time.Now()
+	_, err := f.Fetch(context.Background(), "abc", "sess")
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if elapsed < 900*time.Millisecond || elapsed > 1500*time.Millisecond {
+		t.Fatalf("elapsed = %v, want ~1s (Retry-After alone, not Retry-After+backoff)", elapsed)
+	}
+}
+
+func TestHTTPFetcherContextCancelAbortsRetryLoop(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	f := NewHTTPFetcher(srv.URL+"/", nil, RetryConfig{MaxRetries: 100, BaseDelay: time.Second, MaxDelay: time.Second})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := f.Fetch(ctx, "abc", "sess")
+		done <- err
+	}()
+
+	// give Fetch time to send its first request, which the server holds
+	// open, then cancel: it should return promptly instead of waiting on the
+	// server or retrying after the 1s BaseDelay.
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Fetch returned nil error after ctx cancellation")
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Fetch did not return promptly after ctx cancellation")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// AuthError is returned by a Fetcher when a response indicates the session
+// token it was given has expired or was rejected, as opposed to a generic
+// non-200 response. A SessionManager uses this to know when to renew a
+// session and retry, rather than treating the fetch as a hard failure.
+type AuthError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("auth failure: status %d", e.StatusCode)
+}
+
+// defaultAuthStatusCodes are the response codes HTTPFetcher treats as an
+// expired/rejected session unless overridden.
+var defaultAuthStatusCodes = []int{401, 403}
+
+// SessionManager maintains a pool of K session tokens fetched via fetch,
+// transparently renewing whichever one a caller reports as expired.
+// Workers acquire a session per request rather than closing over a single
+// string, so fetches load-balance across the pool and a single session's
+// server-side rate limit doesn't bottleneck the crawl.
+type SessionManager struct {
+	fetch func() (string, error)
+
+	mu       sync.Mutex
+	sessions []string
+	next     int
+}
+
+// NewSessionManager fetches size sessions up front (size < 1 is treated as
+// 1) and returns a SessionManager load-balancing across them.
+func NewSessionManager(fetch func() (string, error), size int) (*SessionManager, error) {
+	if size < 1 {
+		size = 1
+	}
+	sessions := make([]string, size)
+	for i := range sessions {
+		s, err := fetch()
+		if err != nil {
+			return nil, fmt.Errorf("fetch session %d/%d: %w", i+1, size, err)
+		}
+		sessions[i] = s
+	}
+	return &SessionManager{fetch: fetch, sessions: sessions}, nil
+}
+
+// Acquire returns a session token and the pool slot it came from. Pass the
+// slot back to Renew if the caller later finds that session expired.
+func (sm *SessionManager) Acquire() (session string, slot int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	slot = sm.next
+	sm.next = (sm.next + 1) % len(sm.sessions)
+	return sm.sessions[slot], slot
+}
+
+// Renew fetches a fresh session and installs it at slot, returning the new
+// token.
+func (sm *SessionManager) Renew(slot int) (string, error) {
+	s, err := sm.fetch()
+	if err != nil {
+		return "", err
+	}
+	sm.mu.Lock()
+	sm.sessions[slot] = s
+	sm.mu.Unlock()
+	return s, nil
+}
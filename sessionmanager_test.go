@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSessionManagerAcquireRoundRobins(t *testing.T) {
+	sm, err := NewSessionManager(func() (string, error) {
+		return "s", nil
+	}, 3)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+
+	var slots []int
+	for i := 0; i < 6; i++ {
+		_, slot := sm.Acquire()
+		slots = append(slots, slot)
+	}
+	want := []int{0, 1, 2, 0, 1, 2}
+	for i, slot := range slots {
+		if slot != want[i] {
+			t.Fatalf("slots = %v, want %v", slots, want)
+		}
+	}
+}
+
+func TestSessionManagerRenewReplacesSlot(t *testing.T) {
+	calls := 0
+	sm, err := NewSessionManager(func() (string, error) {
+		calls++
+		return fmt.Sprintf("session-%d", calls), nil
+	}, 2)
+	if err != nil {
+		t.Fatalf("NewSessionManager: %v", err)
+	}
+
+	session, slot := sm.Acquire()
+	if session != "session-1" {
+		t.Fatalf("session = %q, want session-1", session)
+	}
+
+	renewed, err := sm.Renew(slot)
+	if err != nil {
+		t.Fatalf("Renew: %v", err)
+	}
+	if renewed == session {
+		t.Fatalf("Renew returned the same session %q, want a fresh one", renewed)
+	}
+
+	// the pool should now hand out the renewed session for that slot
+	sm.Acquire() // consume the other slot first
+	got, gotSlot := sm.Acquire()
+	if gotSlot != slot {
+		t.Fatalf("Acquire slot = %d, want %d", gotSlot, slot)
+	}
+	if got != renewed {
+		t.Fatalf("Acquire after Renew = %q, want %q", got, renewed)
+	}
+}
+
+func TestAuthBodyContains(t *testing.T) {
+	match := AuthBodyContains("session_expired")
+	if !match([]byte(`{"error":"session_expired"}`)) {
+		t.Fatal("expected match on body containing the substring")
+	}
+	if match([]byte(`{"secret":"hunter2"}`)) {
+		t.Fatal("expected no match on unrelated body")
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultCheckpointBatchSize and defaultFlushInterval are FileStateStore's
+// default flush thresholds: a write flushes to disk once either one is
+// reached.
+const (
+	defaultCheckpointBatchSize = 50
+	defaultFlushInterval       = 2 * time.Second
+)
+
+// FrontierJob is the checkpointed form of a still-outstanding fetch job, so
+// a crawl can be resumed without re-walking nodes it already finished.
+type FrontierJob struct {
+	ID         string `json:"id"`
+	ParentID   string `json:"parent_id"`
+	OrderIndex int    `json:"order_index"`
+}
+
+// VisitedRecord is a single checkpointed node: where it sits in the tree
+// (ParentID) plus the secret that was resolved for it.
+type VisitedRecord struct {
+	ParentID string `json:"parent_id"`
+	Secret   Secret `json:"secret"`
+}
+
+// StateStore persists crawl progress (visited nodes and the outstanding
+// frontier) so a crawl can be checkpointed and resumed after a crash or
+// session expiry instead of restarting from "start". Implementations must
+// be safe for concurrent use.
+type StateStore interface {
+	// PutVisited records that id has been fetched and resolved to rec.
+	PutVisited(id string, rec VisitedRecord) error
+	// GetVisited reports whether id has already been recorded.
+	GetVisited(id string) (VisitedRecord, bool, error)
+	// IterateVisited calls fn once per recorded node. Iteration stops at the
+	// first error fn returns.
+	IterateVisited(fn func(id string, rec VisitedRecord) error) error
+
+	// Checkpoint records a newly visited node alongside the current
+	// outstanding frontier. Implementations may batch the underlying
+	// persistence (e.g. writing to disk only every few checkpoints) rather
+	// than synchronously persisting every call; callers that need the
+	// latest checkpoint durable, such as before reporting a crawl finished,
+	// must call Flush.
+	Checkpoint(id string, rec VisitedRecord, frontier []FrontierJob) error
+	// Frontier returns the last checkpointed set of outstanding jobs.
+	Frontier() ([]FrontierJob, error)
+	// Flush persists any batched checkpoints immediately.
+	Flush() error
+}
+
+// MemoryStateStore is an in-process StateStore backed by a map. It does not
+// survive a process restart; use it for tests or one-shot crawls.
+type MemoryStateStore struct {
+	mu       sync.Mutex
+	visited  map[string]VisitedRecord
+	frontier []FrontierJob
+}
+
+// NewMemoryStateStore returns an empty MemoryStateStore.
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{visited: map[string]VisitedRecord{}}
+}
+
+func (s *MemoryStateStore) PutVisited(id string, rec VisitedRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.visited[id] = rec
+	return nil
+}
+
+func (s *MemoryStateStore) GetVisited(id string) (VisitedRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.visited[id]
+	return rec, ok, nil
+}
+
+func (s *MemoryStateStore) IterateVisited(fn func(id string, rec VisitedRecord) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, rec := range s.visited {
+		if err := fn(id, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStateStore) Checkpoint(id string, rec VisitedRecord, frontier []FrontierJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.visited[id] = rec
+	s.frontier = frontier
+	return nil
+}
+
+func (s *MemoryStateStore) Frontier() ([]FrontierJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frontier, nil
+}
+
+// Flush is a no-op: MemoryStateStore never batches, every Checkpoint is
+// already visible to PutVisited/GetVisited/Frontier.
+func (s *MemoryStateStore) Flush() error {
+	return nil
+}
+
+// fileState is the JSON document persisted by FileStateStore.
+type fileState struct {
+	Visited  map[string]VisitedRecord `json:"visited"`
+	Frontier []FrontierJob            `json:"frontier"`
+}
+
+// FileStateStore is an on-disk StateStore that checkpoints to a single JSON
+// file via write-to-temp-then-rename, so a crash mid-write never corrupts
+// the last good checkpoint. It's the stdlib-only stand-in for a
+// BoltDB/Badger/etcd/Redis backend in this dependency-free tree (this
+// repo has no module manifest to vendor a real KV store against): any of
+// those can be plugged in later by implementing StateStore against the same
+// visited/frontier shape. To keep a long crawl from paying an O(n) rewrite
+// of the whole state file on every single resolved node, writes are batched
+// behind BatchSize/FlushInterval and only hit disk once one threshold is
+// crossed; call Flush for a synchronous write of whatever's pending.
+type FileStateStore struct {
+	// BatchSize is the number of Checkpoint/PutVisited calls allowed to
+	// accumulate in memory before they're flushed to disk. Defaults to
+	// defaultCheckpointBatchSize if left zero.
+	BatchSize int
+	// FlushInterval makes the next write flush to disk, regardless of
+	// BatchSize, once this long has passed since the last flush, so a slow
+	// trickle of nodes still checkpoints. It is checked only when a write
+	// arrives: there is no background timer, so writes made before a pause
+	// stay unflushed until the next write or Flush. Defaults to
+	// defaultFlushInterval if left zero.
+	FlushInterval time.Duration
+
+	mu               sync.Mutex
+	path             string
+	state            fileState
+	writesSinceFlush int
+	lastFlush        time.Time
+	dirty            bool
+}
+
+// OpenFileStateStore loads path if it exists (resuming a prior crawl), or
+// starts a fresh, empty store otherwise.
+func OpenFileStateStore(path string) (*FileStateStore, error) {
+	s := &FileStateStore{
+		path:          path,
+		state:         fileState{Visited: map[string]VisitedRecord{}},
+		BatchSize:     defaultCheckpointBatchSize,
+		FlushInterval: defaultFlushInterval,
+		lastFlush:     time.Now(),
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return nil, fmt.Errorf("parse state file %s: %w", path, err)
+	}
+	if s.state.Visited == nil {
+		s.state.Visited = map[string]VisitedRecord{}
+	}
+	return s, nil
+}
+
+func (s *FileStateStore) PutVisited(id string, rec VisitedRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Visited[id] = rec
+	return s.markDirtyLocked()
+}
+
+func (s *FileStateStore) GetVisited(id string) (VisitedRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.state.Visited[id]
+	return rec, ok, nil
+}
+
+func (s *FileStateStore) IterateVisited(fn func(id string, rec VisitedRecord) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, rec := range s.state.Visited {
+		if err := fn(id, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FileStateStore) Checkpoint(id string, rec VisitedRecord, frontier []FrontierJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Visited[id] = rec
+	s.state.Frontier = frontier
+	return s.markDirtyLocked()
+}
+
+func (s *FileStateStore) Frontier() ([]FrontierJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.Frontier, nil
+}
+
+// Flush persists any batched writes immediately, if there are any pending.
+func (s *FileStateStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	return s.flushLocked()
+}
+
+// markDirtyLocked records that s.state changed and persists it once
+// BatchSize writes have accumulated or FlushInterval has elapsed since the
+// last flush, whichever comes first. Callers must hold s.mu.
+func (s *FileStateStore) markDirtyLocked() error {
+	s.writesSinceFlush++
+	batchSize := s.BatchSize
+	if batchSize < 1 {
+		batchSize = defaultCheckpointBatchSize
+	}
+	flushInterval := s.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	if s.writesSinceFlush < batchSize && time.Since(s.lastFlush) < flushInterval {
+		s.dirty = true
+		return nil
+	}
+	return s.flushLocked()
+}
+
+// flushLocked writes s.state to a temp file, renames it over s.path, and
+// resets the batching counters. Callers must hold s.mu.
+func (s *FileStateStore) flushLocked() error {
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.writesSinceFlush = 0
+	s.lastFlush = time.Now()
+	s.dirty = false
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStateStoreBatchesWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStateStore: %v", err)
+	}
+	s.BatchSize = 10
+	s.FlushInterval = time.Hour // only exercise the count-based threshold here
+
+	for i := 0; i < 5; i++ {
+		id := string(rune('a' + i))
+		rec := VisitedRecord{ParentID: "p", Secret: Secret{ID: id}}
+		if err := s.Checkpoint(id, rec, nil); err != nil {
+			t.Fatalf("Checkpoint: %v", err)
+		}
+	}
+
+	// 5 writes is under BatchSize(10), so nothing should have hit disk yet.
+	beforeFlush, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("re-open before flush: %v", err)
+	}
+	if got := len(beforeFlush.state.Visited); got != 0 {
+		t.Fatalf("visited count before Flush = %d, want 0 (writes should still be batched)", got)
+	}
+
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	afterFlush, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("re-open after flush: %v", err)
+	}
+	if got := len(afterFlush.state.Visited); got != 5 {
+		t.Fatalf("visited count after Flush = %d, want 5", got)
+	}
+}
+
+func TestFileStateStoreFlushPersistsPendingWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStateStore: %v", err)
+	}
+	s.BatchSize = 1000 // large enough that a single write never auto-flushes
+
+	rec := VisitedRecord{ParentID: "p", Secret: Secret{ID: "x"}}
+	if err := s.Checkpoint("x", rec, []FrontierJob{{ID: "y", ParentID: "x"}}); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	reopened, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("re-open: %v", err)
+	}
+	rec2, ok, err := reopened.GetVisited("x")
+	if err != nil || !ok {
+		t.Fatalf("GetVisited(x) = %v, %v, %v, want present", rec2, ok, err)
+	}
+	frontier, err := reopened.Frontier()
+	if err != nil || len(frontier) != 1 || frontier[0].ID != "y" {
+		t.Fatalf("Frontier() = %v, %v, want one job for %q", frontier, err, "y")
+	}
+}
+
+func TestFileStateStoreResumesFrontier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStateStore: %v", err)
+	}
+	frontier := []FrontierJob{{ID: "a", ParentID: "ROOT"}, {ID: "b", ParentID: "ROOT"}}
+	if err := s.Checkpoint("root-child", VisitedRecord{}, frontier); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	resumed, err := OpenFileStateStore(path)
+	if err != nil {
+		t.Fatalf("re-open to resume: %v", err)
+	}
+	got, err := resumed.Frontier()
+	if err != nil || len(got) != 2 {
+		t.Fatalf("Frontier() = %v, %v, want 2 jobs", got, err)
+	}
+}
+
+func TestMemoryStateStoreFlushIsNoop(t *testing.T) {
+	s := NewMemoryStateStore()
+	if err := s.Checkpoint("a", VisitedRecord{}, nil); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+}
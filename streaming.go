@@ -0,0 +1,117 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"io"
+)
+
+// secretHeap is a min-heap of Secret ordered by OrderIndex, used to buffer a
+// parent's children until the next one in DFS order has arrived.
+type secretHeap []Secret
+
+func (h secretHeap) Len() int            { return len(h) }
+func (h secretHeap) Less(i, j int) bool  { return h[i].OrderIndex < h[j].OrderIndex }
+func (h secretHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *secretHeap) Push(x interface{}) { *h = append(*h, x.(Secret)) }
+func (h *secretHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// streamEmitter walks a crawl's results in DFS-preorder as they arrive,
+// writing each resolved secret to w the moment every earlier-ordered
+// ancestor and sibling has already been emitted, instead of waiting for the
+// whole tree to be fetched. A child that arrives before its turn is buffered
+// in a per-parent min-heap keyed by OrderIndex; once a parent's children are
+// fully emitted, its heap and counters are discarded so memory only holds
+// the currently-open frontier of the tree, not everything seen so far.
+type streamEmitter struct {
+	w       io.Writer
+	pending map[string]*secretHeap
+	nextIdx map[string]int
+	// total is the number of children a node has, known once the node
+	// itself has been resolved (0 for a leaf). Missing until then.
+	total map[string]int
+}
+
+func newStreamEmitter(w io.Writer) *streamEmitter {
+	return &streamEmitter{
+		w:       w,
+		pending: map[string]*secretHeap{},
+		nextIdx: map[string]int{},
+		total:   map[string]int{},
+	}
+}
+
+// setChildCount records how many children id has, so drain knows when id's
+// subtree is fully emitted and can be discarded.
+func (e *streamEmitter) setChildCount(id string, n int) {
+	e.total[id] = n
+}
+
+// add buffers a newly-resolved child of parentID and emits as much of the
+// tree as is now unblocked.
+func (e *streamEmitter) add(parentID string, secret Secret) {
+	h, ok := e.pending[parentID]
+	if !ok {
+		h = &secretHeap{}
+		e.pending[parentID] = h
+	}
+	heap.Push(h, secret)
+	e.drain(parentID)
+}
+
+// drain emits every buffered child of id whose OrderIndex is next in line,
+// descending into each one's own subtree before its sibling so the output
+// stays in DFS-preorder. Once id's subtree is fully emitted its bookkeeping
+// is dropped.
+func (e *streamEmitter) drain(id string) {
+	h, ok := e.pending[id]
+	if !ok {
+		// A childless node never gets a pending heap (nothing is ever
+		// pushed under its id), so it must be reaped here instead of in the
+		// branch below or its total entry would leak for the life of the
+		// crawl.
+		if n, known := e.total[id]; known && n == 0 {
+			delete(e.total, id)
+		}
+		return
+	}
+	for h.Len() > 0 && (*h)[0].OrderIndex == e.nextIdx[id] {
+		secret := heap.Pop(h).(Secret)
+		e.nextIdx[id]++
+		if secret.Value != "" && secret.Value != "no" {
+			fmt.Fprint(e.w, secret.Value)
+		}
+		e.drain(secret.ID)
+	}
+	if h.Len() == 0 && e.nextIdx[id] >= e.total[id] {
+		delete(e.pending, id)
+		delete(e.nextIdx, id)
+		delete(e.total, id)
+	}
+}
+
+// CrawlStream behaves like Crawl but streams secrets to w in DFS order as
+// they're resolved, instead of accumulating the whole tree in memory before
+// printing. It never holds more than the currently-open frontier of the
+// tree: a subtree is discarded from the emitter's buffers the instant it's
+// fully emitted.
+func CrawlStream(ctx context.Context, w io.Writer, startID string, opts CrawlOptions) error {
+	emitter := newStreamEmitter(w)
+	emitter.setChildCount(rootID, 1) // the root always has exactly one child: startID
+
+	return crawlLoop(ctx, startID, opts, func(idResponse CurbIDResponse, secret Secret) {
+		children := 0
+		if idResponse.Secret == "no" {
+			children = len(idResponse.Next.IDs)
+		}
+		emitter.setChildCount(idResponse.ID, children)
+		emitter.add(idResponse.ParentID, secret)
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// TestCrawlStreamEmitsSiblingsInOrder checks that siblings are emitted in
+// OrderIndex order even though multiple workers may resolve them out of
+// order: an out-of-order arrival must be buffered in the parent's heap
+// instead of printed immediately.
+func TestCrawlStreamEmitsSiblingsInOrder(t *testing.T) {
+	f := &mockFetcher{tree: map[string]mockNode{
+		"a": {secret: "no", next: []string{"b", "c", "d"}},
+		"b": {secret: "1"},
+		"c": {secret: "2", blockFor: 10 * time.Millisecond}, // resolves after its siblings
+		"d": {secret: "3"},
+	}}
+
+	var buf bytes.Buffer
+	if err := CrawlStream(context.Background(), &buf, "a", CrawlOptions{Fetcher: f, Workers: 4}); err != nil {
+		t.Fatalf("CrawlStream: %v", err)
+	}
+	if got := buf.String(); got != "123" {
+		t.Fatalf("output = %q, want %q (sibling order must not depend on resolution order)", got, "123")
+	}
+}
+
+// TestCrawlStreamDrainsBookkeeping exercises chunk0-4's leak fix: a leaf
+// node (one with zero children, like "b" and "c" below) must not leave a
+// stray entry in streamEmitter's internal maps after the crawl completes,
+// since a childless id never gets a pending heap of its own to trigger
+// cleanup from.
+func TestCrawlStreamDrainsBookkeeping(t *testing.T) {
+	emitter := newStreamEmitter(&bytes.Buffer{})
+	emitter.setChildCount(rootID, 1)
+	emitter.setChildCount("a", 2)
+	emitter.setChildCount("b", 0) // leaf, childless
+	emitter.setChildCount("c", 0) // leaf, childless
+
+	emitter.add(rootID, Secret{ID: "a", OrderIndex: 0})
+	emitter.add("a", Secret{ID: "b", OrderIndex: 0})
+	emitter.add("a", Secret{ID: "c", OrderIndex: 1})
+
+	if n := len(emitter.total); n != 0 {
+		t.Fatalf("emitter.total has %d leftover entries, want 0: %v", n, emitter.total)
+	}
+	if n := len(emitter.pending); n != 0 {
+		t.Fatalf("emitter.pending has %d leftover entries, want 0", n)
+	}
+	if n := len(emitter.nextIdx); n != 0 {
+		t.Fatalf("emitter.nextIdx has %d leftover entries, want 0", n)
+	}
+}